@@ -1,23 +1,28 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"regexp"
+	"runtime"
 	"strings"
 
-	"golang.org/x/sync/errgroup"
+	"github.com/trofkm/files_merger/merger"
 )
 
 var (
 	extensions    = flag.String("extensions", "go", "file extensions to be parsed comma separated(without dots)")
 	output        = flag.String("output", "output.txt", "output file name")
-	ignore        = flag.String("ignore", ".git,.idea", "ignore dirs with these names comma separated")
+	ignoreFiles   = flag.String("ignore-file", ".gitignore", "comma separated list of gitignore-style pattern files (gitignore syntax) applied per directory during traversal")
 	commentSymbol = flag.String("comment", "//", "comment symbol which used to write file name")
-	ignoreRegExp  = flag.String("ignore-reg-exp", "\\b\\B", "regexp to ignore filenames matching this regexp")
+	format        = flag.String("format", "plain", "output format: plain, markdown, json, xml")
+	jobs          = flag.Int("jobs", runtime.NumCPU(), "number of files read concurrently")
+	maxTokens     = flag.Int("max-tokens", 0, "split output into chunks of at most this many estimated tokens (0 = unbounded)")
+	maxBytes      = flag.Int64("max-bytes", 0, "split output into chunks of at most this many bytes (0 = unbounded)")
+	chunkOutput   = flag.String("chunk-output", "", "filename template for chunked output, e.g. output-%03d.txt; required when -max-tokens or -max-bytes is set")
 
 	Usage = func() {
 		fmt.Printf("%s - utility to merge files with their names and contents\n", os.Args[0])
@@ -26,9 +31,6 @@ var (
 	}
 )
 
-// cache to prevent scanning the same file (it is possible if user pass multiple dirs and their paths somehow intersect)
-var pathCache = make(map[string]bool)
-
 const errStr = "Error: %s\n"
 
 func main() {
@@ -40,9 +42,16 @@ func main() {
 		Usage()
 		os.Exit(1)
 	}
-	fmt.Println("saved to " + *output)
+	if *chunkOutput != "" {
+		fmt.Println("saved to " + *chunkOutput)
+	} else {
+		fmt.Println("saved to " + *output)
+	}
 }
 
+// run wires up the CLI flags into a merger.Merger and runs it over the OS filesystem.
+// It is a thin wrapper: all traversal, filtering and formatting logic lives in the
+// merger package so it can be embedded and unit-tested without touching real disk.
 func run() error {
 	paths := flag.Args()
 	if len(paths) == 0 {
@@ -54,55 +63,68 @@ func run() error {
 		return err
 	}
 
-	ignDirs, err := prepareIgnoredDirs(*ignore)
+	ignFileNames, err := prepareIgnoreFileNames(*ignoreFiles)
 	if err != nil {
 		return err
 	}
 
-	file, err := os.OpenFile(*output, os.O_CREATE|os.O_WRONLY, 0644)
+	formatter, err := merger.NewFormatter(*format, *commentSymbol)
 	if err != nil {
-		return fmt.Errorf("could not create output file: %s", err)
+		return err
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}(file)
-
-	outputCh := make(chan []byte, 4)
 
-	receiveAndWrite := func() error {
-		for data := range outputCh {
-			_, err2 := file.Write(data)
-			if err2 != nil {
-				return err2
-			}
-		}
-		return nil
+	if *jobs <= 0 {
+		return fmt.Errorf("jobs must be a positive number")
 	}
 
-	wg := errgroup.Group{}
-	wg.Go(receiveAndWrite)
+	if (*maxTokens > 0 || *maxBytes > 0) && *chunkOutput == "" {
+		return fmt.Errorf("-chunk-output must be set when -max-tokens or -max-bytes is used")
+	}
 
-	reg, err := regexp.Compile(*ignoreRegExp)
+	roots, err := absRoots(paths)
 	if err != nil {
 		return err
 	}
 
-	for _, path := range paths {
-		if err := parse(path, exts, ignDirs, reg, *commentSymbol, outputCh); err != nil {
-			// it's okay, we just print this error and continue
-			fmt.Printf(errStr, err)
+	var m *merger.Merger
+	if *chunkOutput != "" {
+		m = merger.New(exts, ignFileNames, *commentSymbol, formatter, nil)
+		m.ChunkWriterFactory = func(index int) (io.WriteCloser, error) {
+			return os.OpenFile(fmt.Sprintf(*chunkOutput, index), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		}
+		m.MaxTokens = *maxTokens
+		m.MaxBytes = *maxBytes
+	} else {
+		file, err := os.OpenFile(*output, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("could not create output file: %s", err)
 		}
+		defer func(file *os.File) {
+			err := file.Close()
+			if err != nil {
+				fmt.Println(err)
+			}
+		}(file)
+
+		m = merger.New(exts, ignFileNames, *commentSymbol, formatter, file)
 	}
+	m.Jobs = *jobs
 
-	close(outputCh)
+	return m.Merge(context.Background(), os.DirFS("/"), roots...)
+}
 
-	if err := wg.Wait(); err != nil {
-		return err
+// absRoots turns the OS paths the user passed on the command line into fs.FS-style
+// roots rooted at "/", matching the os.DirFS("/") filesystem run() walks them with.
+func absRoots(paths []string) ([]string, error) {
+	roots := make([]string, 0, len(paths))
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, strings.TrimPrefix(filepath.ToSlash(abs), "/"))
 	}
-	return nil
+	return roots, nil
 }
 
 // prepareExtensions trim spaces and add '.' to the extensions
@@ -121,106 +143,20 @@ func prepareExtensions(extensions string) ([]string, error) {
 	return extSplitted, nil
 }
 
-// prepareIgnoredDirs trim spaces from the dir list and split it by comma
-func prepareIgnoredDirs(ignoredDirs string) ([]string, error) {
-	ignoredDirsSplitted := strings.Split(ignoredDirs, ",")
-	if len(ignoredDirsSplitted) == 0 {
-		return nil, fmt.Errorf("ignoredDirs must be a non-empty comma-separated string")
+// prepareIgnoreFileNames trims spaces from the ignore file name list and splits it by comma
+func prepareIgnoreFileNames(ignoreFileNames string) ([]string, error) {
+	namesSplitted := strings.Split(ignoreFileNames, ",")
+	if len(namesSplitted) == 0 {
+		return nil, fmt.Errorf("ignoreFileNames must be a non-empty comma-separated string")
 	}
 
 	// remove duplicates
-	ignoredDirsSplitted = removeDuplicates(ignoredDirsSplitted)
-
-	for i, d := range ignoredDirsSplitted {
-		ignoredDirsSplitted[i] = strings.TrimSpace(d)
-	}
-	return ignoredDirsSplitted, nil
-}
-
-// checkExt checks if the extension is in the allowed list
-func checkExt(name string, allowedExts []string) bool {
-	ext := filepath.Ext(name)
-	for _, e := range allowedExts {
-		if ext == e {
-			return true
-		}
-	}
-	return false
-}
-func isIgnoredDir(dirEntry os.DirEntry, ignoredDirs []string) bool {
-	if !dirEntry.IsDir() {
-		return false
-	}
-
-	for _, d := range ignoredDirs {
-		if dirEntry.Name() == d {
-			return true
-		}
-	}
-	return false
-}
-
-// parse all files in the path with the given extensions and write their contents to the output channel
-func parse(path string, extensions []string, ignoredDirs []string, ignoreFilenameRegex *regexp.Regexp, commentSymbol string, output chan<- []byte) error {
-	buf := bytes.Buffer{}
-
-	err := filepath.WalkDir(path, func(path string, entry os.DirEntry, err error) error {
-
-		// check if entry is not in ignored dir
-		if isIgnoredDir(entry, ignoredDirs) {
-			return filepath.SkipDir
-		}
-
-		if err != nil {
-			return err
-		}
-		if entry.IsDir() {
-			return nil
-		}
-
-		// check if file name matches the ignore regexp
-		if ignoreFilenameRegex.MatchString(entry.Name()) {
-			return nil
-		}
-
-		if !checkExt(entry.Name(), extensions) {
-			return nil
-		}
+	namesSplitted = removeDuplicates(namesSplitted)
 
-		if pathCache[path] {
-			return nil
-		}
-		// file name
-
-		if _, err = fmt.Fprintf(&buf, "%s %s\n", commentSymbol, path); err != nil {
-			return err
-		}
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return err
-		}
-		// the actual file content
-		_, err = fmt.Fprintf(&buf, "%s\n", string(data))
-		if err != nil {
-			return err
-		}
-		// TODO: I tried to do this in a separate goroutine without any additional copy,
-		//  but looks like it's not working, so bytes.Buffer looks useless here
-		btsCopy := make([]byte, len(buf.Bytes()))
-		copy(btsCopy, buf.Bytes())
-		output <- btsCopy
-		buf.Reset()
-
-		pathCache[path] = true
-
-		return nil
-	})
-
-	if err != nil {
-		return err
+	for i, n := range namesSplitted {
+		namesSplitted[i] = strings.TrimSpace(n)
 	}
-
-	return nil
+	return namesSplitted, nil
 }
 
 func removeDuplicates[T comparable](sliceList []T) []T {
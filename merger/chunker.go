@@ -0,0 +1,131 @@
+package merger
+
+import (
+	"fmt"
+	"io"
+)
+
+// chunker accumulates FileRecords into budget-bounded chunks (per Merger.MaxTokens /
+// Merger.MaxBytes) and flushes each one as a self-contained, fully formatted chunk once
+// it is full. A single file that alone exceeds the budget is still emitted whole, in
+// its own chunk, with a warning - files are never split across two chunks.
+type chunker struct {
+	m       *Merger
+	counter TokenCounter
+
+	index   int
+	records []FileRecord
+	tokens  int
+	bytes   int64
+}
+
+func newChunker(m *Merger) *chunker {
+	counter := m.TokenCounter
+	if counter == nil {
+		counter = ByteHeuristicCounter{}
+	}
+	return &chunker{m: m, counter: counter}
+}
+
+// add folds rec into the current chunk, flushing first if it would overflow the
+// budget, and flushing immediately after if rec alone is over budget.
+func (c *chunker) add(rec FileRecord) error {
+	cost := c.counter.Count(rec.Content)
+	size := int64(len(rec.Content))
+
+	if len(c.records) > 0 && c.overflows(cost, size) {
+		if err := c.flush(); err != nil {
+			return err
+		}
+	}
+
+	alone := c.overflows(cost, size)
+	if alone {
+		fmt.Fprintf(c.m.warnings(), "warning: %s alone exceeds the chunk budget, emitting it in its own chunk\n", rec.Path)
+	}
+
+	c.records = append(c.records, rec)
+	c.tokens += cost
+	c.bytes += size
+
+	if alone {
+		return c.flush()
+	}
+	return nil
+}
+
+// overflows reports whether adding cost tokens and size bytes to the current chunk
+// would exceed the configured budget.
+func (c *chunker) overflows(cost int, size int64) bool {
+	if c.m.MaxTokens > 0 && c.tokens+cost > c.m.MaxTokens {
+		return true
+	}
+	if c.m.MaxBytes > 0 && c.bytes+size > c.m.MaxBytes {
+		return true
+	}
+	return false
+}
+
+// flush writes out the current chunk - a short header listing its source paths
+// followed by the records formatted through m.Formatter - and resets for the next one.
+func (c *chunker) flush() error {
+	if len(c.records) == 0 {
+		return nil
+	}
+
+	w, closeChunk, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	if err := c.writeChunk(w); err != nil {
+		_ = closeChunk()
+		return err
+	}
+
+	if err := closeChunk(); err != nil {
+		return err
+	}
+
+	c.index++
+	c.records = c.records[:0]
+	c.tokens = 0
+	c.bytes = 0
+	return nil
+}
+
+func (c *chunker) writeChunk(w io.Writer) error {
+	paths := make([]string, len(c.records))
+	for i, rec := range c.records {
+		paths[i] = rec.Path
+	}
+	if hf, ok := c.m.Formatter.(ChunkHeaderFormatter); ok {
+		if err := hf.WriteChunkHeader(w, c.index, paths); err != nil {
+			return err
+		}
+	}
+
+	if err := c.m.Formatter.Open(w); err != nil {
+		return err
+	}
+	for _, rec := range c.records {
+		if err := c.m.Formatter.Write(w, rec); err != nil {
+			return err
+		}
+	}
+	return c.m.Formatter.Close(w)
+}
+
+// open returns the writer for the current chunk and a function to close it once the
+// chunk is done. When no ChunkWriterFactory is configured, every chunk is written to
+// m.Output and closing is a no-op.
+func (c *chunker) open() (io.Writer, func() error, error) {
+	if c.m.ChunkWriterFactory == nil {
+		return c.m.Output, func() error { return nil }, nil
+	}
+	wc, err := c.m.ChunkWriterFactory(c.index)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wc, wc.Close, nil
+}
@@ -0,0 +1,141 @@
+package merger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"testing"
+	"testing/fstest"
+)
+
+// fakeChunkWriter is an io.WriteCloser backed by a bytes.Buffer, used to capture each
+// chunk's contents in tests without touching the filesystem.
+type fakeChunkWriter struct {
+	bytes.Buffer
+}
+
+func (f *fakeChunkWriter) Close() error { return nil }
+
+func TestMergeChunking(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go": {Data: []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")}, // 50 bytes
+		"b.go": {Data: []byte("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")}, // 50 bytes
+		"c.go": {Data: []byte("cccccccccccccccccccccccccccccccccccccccccccccccc")},   // 48 bytes
+	}
+
+	formatter, err := NewFormatter("plain", "//")
+	if err != nil {
+		t.Fatalf("NewFormatter: %v", err)
+	}
+
+	var chunks []*fakeChunkWriter
+	m := New([]string{".go"}, nil, "//", formatter, nil)
+	m.MaxBytes = 60 // fits one file per chunk, never two
+	m.ChunkWriterFactory = func(index int) (io.WriteCloser, error) {
+		w := &fakeChunkWriter{}
+		chunks = append(chunks, w)
+		return w, nil
+	}
+
+	if err := m.Merge(context.Background(), fsys, "."); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3 (one per file)", len(chunks))
+	}
+	for i, c := range chunks {
+		if bytes.Count(c.Bytes(), []byte("// ")) != 2 { // chunk header + the one file's own comment line
+			t.Errorf("chunk %d: expected exactly one file, got:\n%s", i, c.String())
+		}
+	}
+}
+
+func TestMergeChunkingRoundTripsStrictFormats(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go": {Data: []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")}, // 50 bytes
+		"b.go": {Data: []byte("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")}, // 50 bytes
+	}
+
+	for _, format := range []string{"json", "xml"} {
+		t.Run(format, func(t *testing.T) {
+			formatter, err := NewFormatter(format, "//")
+			if err != nil {
+				t.Fatalf("NewFormatter: %v", err)
+			}
+
+			var chunks []*fakeChunkWriter
+			m := New([]string{".go"}, nil, "//", formatter, nil)
+			m.MaxBytes = 60 // fits one file per chunk, never two
+			m.ChunkWriterFactory = func(index int) (io.WriteCloser, error) {
+				w := &fakeChunkWriter{}
+				chunks = append(chunks, w)
+				return w, nil
+			}
+
+			if err := m.Merge(context.Background(), fsys, "."); err != nil {
+				t.Fatalf("Merge: %v", err)
+			}
+
+			if len(chunks) != 2 {
+				t.Fatalf("got %d chunks, want 2 (one per file)", len(chunks))
+			}
+
+			for i, c := range chunks {
+				switch format {
+				case "json":
+					dec := json.NewDecoder(bytes.NewReader(c.Bytes()))
+					var rec jsonRecord
+					if err := dec.Decode(&rec); err != nil {
+						t.Errorf("chunk %d: not valid NDJSON: %v\ngot:\n%s", i, err, c.String())
+					}
+				case "xml":
+					var doc struct {
+						XMLName xml.Name `xml:"files"`
+						Files   []struct {
+							Path string `xml:"path,attr"`
+						} `xml:"file"`
+					}
+					if err := xml.Unmarshal(c.Bytes(), &doc); err != nil {
+						t.Errorf("chunk %d: not well-formed XML: %v\ngot:\n%s", i, err, c.String())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMergeOversizedFileGetsItsOwnChunk(t *testing.T) {
+	fsys := fstest.MapFS{
+		"big.go":   {Data: bytes.Repeat([]byte("x"), 100)},
+		"small.go": {Data: []byte("small")},
+	}
+
+	formatter, err := NewFormatter("plain", "//")
+	if err != nil {
+		t.Fatalf("NewFormatter: %v", err)
+	}
+
+	var chunks []*fakeChunkWriter
+	m := New([]string{".go"}, nil, "//", formatter, nil)
+	m.MaxBytes = 10 // smaller than big.go alone
+	m.Warnings = io.Discard
+	m.ChunkWriterFactory = func(index int) (io.WriteCloser, error) {
+		w := &fakeChunkWriter{}
+		chunks = append(chunks, w)
+		return w, nil
+	}
+
+	if err := m.Merge(context.Background(), fsys, "."); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	if len(chunks) != 2 {
+		t.Fatalf("got %d chunks, want 2", len(chunks))
+	}
+	if !bytes.Contains(chunks[0].Bytes(), []byte("xxxxxxxxxx")) {
+		t.Errorf("expected the oversized file in its own chunk, got:\n%s", chunks[0].String())
+	}
+}
@@ -0,0 +1,169 @@
+package merger
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// FileRecord is the structured unit Merge emits for every file that survives
+// filtering. Formatters turn a stream of these into whatever output shape is wanted,
+// without needing to know anything about how the file was found.
+type FileRecord struct {
+	Path    string // path as passed to Merge / discovered by fs.WalkDir
+	RelPath string // path relative to the root that was walked to find it
+	Ext     string // file extension, including the leading dot
+	Size    int64
+	Content []byte
+}
+
+// Formatter serializes a stream of FileRecords to w. Open is called once before the
+// first record, Write once per record in discovery order, and Close once after the
+// last record so formatters that need a wrapper (e.g. a JSON array's brackets) can
+// emit it without buffering the whole corpus in memory.
+type Formatter interface {
+	Open(w io.Writer) error
+	Write(w io.Writer, rec FileRecord) error
+	Close(w io.Writer) error
+}
+
+// ChunkHeaderFormatter is implemented by formatters whose syntax tolerates a leading
+// line of chunk metadata (a source path listing). Chunked output only writes this
+// header for formatters that implement it - strict formats like JSON and XML
+// deliberately don't, so chunking never corrupts their output with a stray line.
+type ChunkHeaderFormatter interface {
+	WriteChunkHeader(w io.Writer, index int, paths []string) error
+}
+
+// NewFormatter resolves a -format style name to a Formatter implementation. Supported
+// names are "plain", "markdown", "json" and "xml".
+func NewFormatter(name, commentSymbol string) (Formatter, error) {
+	switch name {
+	case "plain":
+		return &PlainFormatter{CommentSymbol: commentSymbol}, nil
+	case "markdown":
+		return &MarkdownFormatter{}, nil
+	case "json":
+		return &JSONFormatter{}, nil
+	case "xml":
+		return &XMLFormatter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, must be one of plain, markdown, json, xml", name)
+	}
+}
+
+// PlainFormatter reproduces the tool's original output: each file prefixed with a
+// comment line carrying its path, followed by its raw content.
+type PlainFormatter struct {
+	CommentSymbol string
+}
+
+func (f *PlainFormatter) Open(io.Writer) error { return nil }
+
+func (f *PlainFormatter) Write(w io.Writer, rec FileRecord) error {
+	if _, err := fmt.Fprintf(w, "%s %s\n", f.CommentSymbol, rec.Path); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", string(rec.Content)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f *PlainFormatter) Close(io.Writer) error { return nil }
+
+// WriteChunkHeader emits a comment line listing the chunk's source paths, matching
+// the comment syntax already used to separate individual files.
+func (f *PlainFormatter) WriteChunkHeader(w io.Writer, index int, paths []string) error {
+	_, err := fmt.Fprintf(w, "%s chunk %d: %s\n", f.CommentSymbol, index, strings.Join(paths, ", "))
+	return err
+}
+
+// MarkdownFormatter renders each file as a heading followed by a fenced code block,
+// with the language inferred from the file extension.
+type MarkdownFormatter struct{}
+
+func (f *MarkdownFormatter) Open(io.Writer) error { return nil }
+
+func (f *MarkdownFormatter) Write(w io.Writer, rec FileRecord) error {
+	lang := strings.TrimPrefix(rec.Ext, ".")
+	if _, err := fmt.Fprintf(w, "### %s\n\n", rec.Path); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "```%s\n%s\n```\n\n", lang, string(rec.Content)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f *MarkdownFormatter) Close(io.Writer) error { return nil }
+
+// WriteChunkHeader emits the chunk's source paths as an HTML comment, which markdown
+// renderers ignore, so the header never shows up as stray rendered text.
+func (f *MarkdownFormatter) WriteChunkHeader(w io.Writer, index int, paths []string) error {
+	_, err := fmt.Fprintf(w, "<!-- chunk %d: %s -->\n\n", index, strings.Join(paths, ", "))
+	return err
+}
+
+// jsonRecord is the on-the-wire shape for JSONFormatter.
+type jsonRecord struct {
+	Path     string `json:"path"`
+	Language string `json:"language"`
+	Content  string `json:"content"`
+}
+
+// JSONFormatter streams an NDJSON document (one jsonRecord per line) so the whole
+// corpus is never buffered in memory, matching how the rest of the pipeline works.
+type JSONFormatter struct{}
+
+func (f *JSONFormatter) Open(io.Writer) error { return nil }
+
+func (f *JSONFormatter) Write(w io.Writer, rec FileRecord) error {
+	enc := json.NewEncoder(w)
+	return enc.Encode(jsonRecord{
+		Path:     rec.Path,
+		Language: strings.TrimPrefix(rec.Ext, "."),
+		Content:  string(rec.Content),
+	})
+}
+
+func (f *JSONFormatter) Close(io.Writer) error { return nil }
+
+// XMLFormatter emits one <file path="..."> element per record, content XML-escaped.
+type XMLFormatter struct{}
+
+func (f *XMLFormatter) Open(w io.Writer) error {
+	_, err := fmt.Fprint(w, "<files>\n")
+	return err
+}
+
+func (f *XMLFormatter) Write(w io.Writer, rec FileRecord) error {
+	if _, err := fmt.Fprintf(w, "  <file path=%s>", quoteXMLAttr(rec.Path)); err != nil {
+		return err
+	}
+	if err := xml.EscapeText(w, rec.Content); err != nil {
+		return err
+	}
+	_, err := fmt.Fprint(w, "</file>\n")
+	return err
+}
+
+func (f *XMLFormatter) Close(w io.Writer) error {
+	_, err := fmt.Fprint(w, "</files>\n")
+	return err
+}
+
+// quoteXMLAttr renders value as a double-quoted, escaped XML attribute value.
+func quoteXMLAttr(value string) string {
+	var buf strings.Builder
+	_ = xml.EscapeText(&buf, []byte(value))
+	return `"` + buf.String() + `"`
+}
+
+// extOf returns the file extension including its leading dot.
+func extOf(name string) string {
+	return path.Ext(name)
+}
@@ -0,0 +1,242 @@
+package merger
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// defaultIgnoredDirs are always skipped regardless of ignore files, since walking into
+// them is never useful and .git in particular can be enormous.
+var defaultIgnoredDirs = []string{".git", ".idea"}
+
+// ignoreSpec is a single compiled gitignore-style pattern.
+type ignoreSpec struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// dirFrame holds the ignore patterns contributed by the ignore files found in one
+// directory. Frames are pushed when entering a directory and popped once traversal
+// moves on, so patterns only apply to the directory's own descendants.
+type dirFrame struct {
+	dir   string
+	specs []*ignoreSpec
+}
+
+// ignoreMatcher stacks gitignore-style patterns the same way git itself resolves them:
+// patterns from parent directories apply to children, and more specific (deeper) files
+// take precedence over their ancestors. It reads ignore files from an fs.FS, so it works
+// the same whether fsys is backed by the OS, an embed.FS, or an in-memory fstest.MapFS.
+type ignoreMatcher struct {
+	fsys      fs.FS
+	fileNames []string
+	stack     []dirFrame
+}
+
+// newIgnoreMatcher builds a matcher that looks for the given ignore file names (e.g.
+// ".gitignore", ".buildrignore") in every directory it is pushed into.
+func newIgnoreMatcher(fsys fs.FS, fileNames []string) *ignoreMatcher {
+	return &ignoreMatcher{fsys: fsys, fileNames: fileNames}
+}
+
+// sync pops frames that no longer contain dir, keeping the stack aligned with whatever
+// directory fs.WalkDir is currently visiting.
+func (m *ignoreMatcher) sync(dir string) {
+	for len(m.stack) > 0 && !isWithinDir(m.stack[len(m.stack)-1].dir, dir) {
+		m.stack = m.stack[:len(m.stack)-1]
+	}
+}
+
+// push reads any configured ignore files present in dir and stacks their patterns so
+// they apply while dir's descendants are visited.
+func (m *ignoreMatcher) push(dir string) error {
+	var specs []*ignoreSpec
+	for _, name := range m.fileNames {
+		p := name
+		if dir != "." {
+			p = path.Join(dir, name)
+		}
+		fileSpecs, err := loadIgnoreFile(m.fsys, p)
+		if err != nil {
+			return err
+		}
+		specs = append(specs, fileSpecs...)
+	}
+	m.stack = append(m.stack, dirFrame{dir: dir, specs: specs})
+	return nil
+}
+
+// match reports whether p is ignored by any pattern currently on the stack. Patterns
+// are evaluated outer frame to inner frame, last match (including negations) wins, which
+// mirrors git's own precedence rules.
+func (m *ignoreMatcher) match(p string, isDir bool) bool {
+	ignored := false
+	for _, frame := range m.stack {
+		rel := relTo(frame.dir, p)
+		for _, spec := range frame.specs {
+			if spec.dirOnly && !isDir {
+				continue
+			}
+			if spec.re.MatchString(rel) {
+				ignored = !spec.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// isWithinDir reports whether target is dir itself or a descendant of it. Both dir and
+// target are fs.FS-style slash-separated paths.
+func isWithinDir(dir, target string) bool {
+	if dir == target {
+		return true
+	}
+	if dir == "." {
+		return true
+	}
+	return strings.HasPrefix(target, dir+"/")
+}
+
+// relTo returns p relative to dir, both being fs.FS-style slash-separated paths.
+func relTo(dir, p string) string {
+	if dir == "." {
+		return p
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(p, dir), "/")
+}
+
+// loadIgnoreFile parses p as a gitignore-style pattern file. A missing file is not an
+// error: most directories simply won't have one.
+func loadIgnoreFile(fsys fs.FS, p string) ([]*ignoreSpec, error) {
+	data, err := fs.ReadFile(fsys, p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var specs []*ignoreSpec
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		spec, err := compileIgnorePattern(line)
+		if err != nil {
+			return nil, err
+		}
+		if spec != nil {
+			specs = append(specs, spec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// compileIgnorePattern turns one gitignore line into an ignoreSpec. It supports "**"
+// globstars, leading "/" anchoring to the ignore file's own directory, a trailing "/"
+// meaning directory-only, "!" negation and a "(?i)" prefix for case-insensitive matching.
+// A blank result (nil, nil) means the line carried no pattern (e.g. it was just "!").
+func compileIgnorePattern(raw string) (*ignoreSpec, error) {
+	line := raw
+
+	caseInsensitive := false
+	if strings.HasPrefix(line, "(?i)") {
+		caseInsensitive = true
+		line = line[len("(?i)"):]
+	}
+
+	negate := false
+	if strings.HasPrefix(line, "!") {
+		negate = true
+		line = line[1:]
+	}
+
+	if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	dirOnly := strings.HasSuffix(line, "/")
+	line = strings.TrimSuffix(line, "/")
+
+	// gitignore anchors a pattern to the ignore file's own directory not just when it
+	// starts with "/", but whenever it contains a "/" anywhere but the trailing
+	// position - e.g. "foo/bar.go" only matches "foo/bar.go" next to the ignore file,
+	// never "x/foo/bar.go" deeper in the tree.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	if line == "" {
+		return nil, nil
+	}
+
+	body := translateGitignoreGlob(line)
+
+	var pattern string
+	if anchored {
+		pattern = "^" + body + "$"
+	} else {
+		pattern = "^(.*/)?" + body + "$"
+	}
+	if caseInsensitive {
+		pattern = "(?i)" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ignore pattern %q: %s", raw, err)
+	}
+
+	return &ignoreSpec{re: re, negate: negate, dirOnly: dirOnly}, nil
+}
+
+// translateGitignoreGlob converts the glob syntax understood by gitignore files
+// ("**", "*", "?") into the body of an equivalent regexp, escaping everything else.
+func translateGitignoreGlob(pattern string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**"):
+			sb.WriteString("/.*")
+			i += 2
+		case pattern[i] == '*':
+			sb.WriteString("[^/]*")
+		case pattern[i] == '?':
+			sb.WriteString("[^/]")
+		case strings.ContainsRune(`\.+()|^$[]{}`, rune(pattern[i])):
+			sb.WriteByte('\\')
+			sb.WriteByte(pattern[i])
+		default:
+			sb.WriteByte(pattern[i])
+		}
+	}
+	return sb.String()
+}
+
+// isIgnoredDir reports whether entry is one of the always-ignored directories.
+func isIgnoredDir(entry fs.DirEntry) bool {
+	if !entry.IsDir() {
+		return false
+	}
+
+	for _, d := range defaultIgnoredDirs {
+		if entry.Name() == d {
+			return true
+		}
+	}
+	return false
+}
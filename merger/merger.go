@@ -0,0 +1,303 @@
+// Package merger implements the traversal and serialization behind the files_merger
+// CLI as a reusable library. A Merger can be pointed at any io/fs.FS - the real OS
+// filesystem, an embed.FS, a zip.Reader, or an in-memory fstest.MapFS in tests - which
+// keeps the core logic unit-testable without touching real disk.
+package merger
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Merger walks one or more roots of an fs.FS, filters files by extension and ignore
+// rules, and writes them out through a Formatter.
+type Merger struct {
+	Extensions      []string
+	IgnoreFileNames []string
+	CommentSymbol   string
+	Formatter       Formatter
+	Output          io.Writer
+
+	// Jobs bounds how many files are read concurrently. Zero means runtime.NumCPU().
+	Jobs int
+
+	// MaxTokens and MaxBytes bound how much a single output chunk may hold. Zero means
+	// unbounded. A single file that alone exceeds the budget is still emitted whole,
+	// in its own chunk, with a warning written to Warnings (or os.Stderr if nil).
+	MaxTokens int
+	MaxBytes  int64
+
+	// TokenCounter estimates the token cost of a file's content when MaxTokens is set.
+	// Defaults to ByteHeuristicCounter.
+	TokenCounter TokenCounter
+
+	// ChunkWriterFactory opens the writer for the chunk at index (0-based) when
+	// chunked output is in use. If nil, all chunks are written to Output one after
+	// another, separated only by the headers of formatters that implement
+	// ChunkHeaderFormatter; chunks of the json and xml formats carry no header.
+	ChunkWriterFactory func(index int) (io.WriteCloser, error)
+
+	// Warnings receives non-fatal warnings (e.g. a file alone exceeding the chunk
+	// budget). Defaults to os.Stderr.
+	Warnings io.Writer
+}
+
+// New builds a Merger with Jobs defaulted to runtime.NumCPU().
+func New(extensions []string, ignoreFileNames []string, commentSymbol string, formatter Formatter, output io.Writer) *Merger {
+	return &Merger{
+		Extensions:      extensions,
+		IgnoreFileNames: ignoreFileNames,
+		CommentSymbol:   commentSymbol,
+		Formatter:       formatter,
+		Output:          output,
+		Jobs:            runtime.NumCPU(),
+	}
+}
+
+// seqRecord pairs a FileRecord with the monotonic sequence number it was assigned at
+// discovery time, so Merge can restore the original walk order even though the files
+// themselves are read out of order by a worker pool.
+type seqRecord struct {
+	seq int64
+	rec FileRecord
+}
+
+// seqHeap is a container/heap of seqRecords ordered by seq, used to buffer records
+// until it's their turn to be flushed.
+type seqHeap []seqRecord
+
+func (h seqHeap) Len() int            { return len(h) }
+func (h seqHeap) Less(i, j int) bool  { return h[i].seq < h[j].seq }
+func (h seqHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *seqHeap) Push(x interface{}) { *h = append(*h, x.(seqRecord)) }
+func (h *seqHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// Merge walks each of roots within fsys, collecting every file whose extension is
+// allowed and that isn't excluded by an ignore file, and writes them to m.Output via
+// m.Formatter. Sequence numbers are shared across every root so the output stays in a
+// single, deterministic order no matter how the roots are split up by the caller.
+func (m *Merger) Merge(ctx context.Context, fsys fs.FS, roots ...string) error {
+	jobs := m.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	chunking := m.MaxTokens > 0 || m.MaxBytes > 0 || m.ChunkWriterFactory != nil
+	if !chunking {
+		if err := m.Formatter.Open(m.Output); err != nil {
+			return err
+		}
+	}
+
+	outputCh := make(chan seqRecord, 4)
+	writer, writerCtx := errgroup.WithContext(ctx)
+	writer.Go(func() error {
+		var chunk *chunker
+		if chunking {
+			chunk = newChunker(m)
+		}
+
+		pending := &seqHeap{}
+		var next int64
+		for sr := range outputCh {
+			heap.Push(pending, sr)
+			for pending.Len() > 0 && (*pending)[0].seq == next {
+				item := heap.Pop(pending).(seqRecord)
+				if chunking {
+					if err := chunk.add(item.rec); err != nil {
+						return err
+					}
+				} else if err := m.Formatter.Write(m.Output, item.rec); err != nil {
+					return err
+				}
+				next++
+			}
+		}
+
+		// a failed read leaves a gap in the sequence; write whatever is still
+		// buffered, in order, so records of the roots that did succeed are not lost
+		for pending.Len() > 0 {
+			item := heap.Pop(pending).(seqRecord)
+			if chunking {
+				if err := chunk.add(item.rec); err != nil {
+					return err
+				}
+			} else if err := m.Formatter.Write(m.Output, item.rec); err != nil {
+				return err
+			}
+		}
+
+		if chunking {
+			return chunk.flush()
+		}
+		return nil
+	})
+
+	var pathCache sync.Map
+	var seq int64
+
+	for _, root := range roots {
+		if err := writerCtx.Err(); err != nil {
+			// the writer has already failed; no point walking further roots
+			break
+		}
+		im := newIgnoreMatcher(fsys, m.IgnoreFileNames)
+		if err := m.walkRoot(writerCtx, fsys, root, im, jobs, &pathCache, &seq, outputCh); err != nil {
+			// a single bad root (missing dir, permission error, ...) shouldn't sink the
+			// whole run - report it and keep merging the roots that do exist
+			fmt.Fprintf(m.warnings(), "warning: %s: %s\n", root, err)
+		}
+	}
+
+	close(outputCh)
+
+	var err error
+	if werr := writer.Wait(); werr != nil {
+		err = werr
+	}
+
+	if !chunking {
+		if cerr := m.Formatter.Close(m.Output); cerr != nil {
+			err = errors.Join(err, cerr)
+		}
+	}
+
+	return err
+}
+
+// warnings returns where non-fatal warnings (a failed root, an oversized chunk file)
+// should be written. Defaults to os.Stderr.
+func (m *Merger) warnings() io.Writer {
+	if m.Warnings != nil {
+		return m.Warnings
+	}
+	return os.Stderr
+}
+
+// walkRoot reads up to jobs files under root concurrently and pushes a seqRecord for
+// each to output. seq is shared across every root in a single Merge call.
+func (m *Merger) walkRoot(ctx context.Context, fsys fs.FS, root string, im *ignoreMatcher, jobs int, pathCache *sync.Map, seq *int64, output chan<- seqRecord) error {
+	g, gctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, jobs)
+
+	walkErr := fs.WalkDir(fsys, root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if gctx.Err() != nil {
+			return gctx.Err()
+		}
+
+		// check if entry is not in an always-ignored dir
+		if isIgnoredDir(entry) {
+			return fs.SkipDir
+		}
+
+		if entry.IsDir() {
+			im.sync(parentOf(p))
+			if p != root && im.match(p, true) {
+				return fs.SkipDir
+			}
+			return im.push(p)
+		}
+
+		im.sync(parentOf(p))
+
+		// check if the file is ignored by any .gitignore-style pattern file in its path
+		if im.match(p, false) {
+			return nil
+		}
+
+		if !checkExt(entry.Name(), m.Extensions) {
+			return nil
+		}
+
+		if _, alreadySeen := pathCache.LoadOrStore(p, true); alreadySeen {
+			return nil
+		}
+
+		n := atomic.AddInt64(seq, 1) - 1
+
+		select {
+		case sem <- struct{}{}:
+		case <-gctx.Done():
+			return gctx.Err()
+		}
+
+		g.Go(func() error {
+			defer func() { <-sem }()
+
+			data, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+
+			sr := seqRecord{
+				seq: n,
+				rec: FileRecord{
+					Path:    p,
+					RelPath: relTo(root, p),
+					Ext:     extOf(entry.Name()),
+					Size:    int64(len(data)),
+					Content: data,
+				},
+			}
+
+			select {
+			case output <- sr:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			return nil
+		})
+
+		return nil
+	})
+
+	if walkErr != nil {
+		_ = g.Wait()
+		return walkErr
+	}
+
+	return g.Wait()
+}
+
+// parentOf returns the fs.FS-style parent directory of p, or "." if p has none.
+func parentOf(p string) string {
+	i := len(p) - 1
+	for i >= 0 && p[i] != '/' {
+		i--
+	}
+	if i < 0 {
+		return "."
+	}
+	return p[:i]
+}
+
+// checkExt reports whether name's extension is in allowedExts.
+func checkExt(name string, allowedExts []string) bool {
+	ext := extOf(name)
+	for _, e := range allowedExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
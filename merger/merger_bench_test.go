@@ -0,0 +1,48 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// benchTree writes n small .go files into a fresh directory and returns its path.
+func benchTree(b *testing.B, n int) string {
+	b.Helper()
+
+	dir := b.TempDir()
+	for i := 0; i < n; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("file%d.go", i))
+		content := fmt.Sprintf("package main\n\nfunc F%d() int { return %d }\n", i, i)
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func benchmarkMerge(b *testing.B, files, jobs int) {
+	dir := benchTree(b, files)
+	fsys := os.DirFS(dir)
+
+	formatter, err := NewFormatter("plain", "//")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m := New([]string{".go"}, []string{".gitignore"}, "//", formatter, io.Discard)
+		m.Jobs = jobs
+		if err := m.Merge(context.Background(), fsys, "."); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMergeSequential(b *testing.B) { benchmarkMerge(b, 5000, 1) }
+func BenchmarkMergeJobs4(b *testing.B)      { benchmarkMerge(b, 5000, 4) }
+func BenchmarkMergeJobs16(b *testing.B)     { benchmarkMerge(b, 5000, 16) }
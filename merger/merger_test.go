@@ -0,0 +1,131 @@
+package merger
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name          string
+		fsys          fstest.MapFS
+		extensions    []string
+		ignoreFiles   []string
+		commentSymbol string
+		roots         []string
+		wantContains  []string
+		wantExcludes  []string
+	}{
+		{
+			name: "filters by extension",
+			fsys: fstest.MapFS{
+				"a.go":  {Data: []byte("package a")},
+				"b.txt": {Data: []byte("not go")},
+			},
+			extensions:    []string{".go"},
+			commentSymbol: "//",
+			roots:         []string{"."},
+			wantContains:  []string{"package a"},
+			wantExcludes:  []string{"not go"},
+		},
+		{
+			name: "honors ignore file patterns",
+			fsys: fstest.MapFS{
+				".gitignore":  {Data: []byte("ignored.go\n")},
+				"ignored.go":  {Data: []byte("package ignored")},
+				"included.go": {Data: []byte("package included")},
+			},
+			extensions:    []string{".go"},
+			ignoreFiles:   []string{".gitignore"},
+			commentSymbol: "//",
+			roots:         []string{"."},
+			wantContains:  []string{"package included"},
+			wantExcludes:  []string{"package ignored"},
+		},
+		{
+			name: "negated pattern overrides an ignore",
+			fsys: fstest.MapFS{
+				".gitignore": {Data: []byte("*.go\n!keep.go\n")},
+				"keep.go":    {Data: []byte("package keep")},
+				"skip.go":    {Data: []byte("package skip")},
+			},
+			extensions:    []string{".go"},
+			ignoreFiles:   []string{".gitignore"},
+			commentSymbol: "//",
+			roots:         []string{"."},
+			wantContains:  []string{"package keep"},
+			wantExcludes:  []string{"package skip"},
+		},
+		{
+			name: "ignore rules stack per directory",
+			fsys: fstest.MapFS{
+				".gitignore":     {Data: []byte("sub/skip.go\n")},
+				"sub/.gitignore": {Data: []byte("local.go\n")},
+				"sub/skip.go":    {Data: []byte("package skip")},
+				"sub/local.go":   {Data: []byte("package local")},
+				"sub/keep.go":    {Data: []byte("package keep")},
+			},
+			extensions:    []string{".go"},
+			ignoreFiles:   []string{".gitignore"},
+			commentSymbol: "//",
+			roots:         []string{"."},
+			wantContains:  []string{"package keep"},
+			wantExcludes:  []string{"package skip", "package local"},
+		},
+		{
+			name: "an internal slash anchors the pattern to the ignore file's directory",
+			fsys: fstest.MapFS{
+				".gitignore":   {Data: []byte("foo/bar.go\n")},
+				"foo/bar.go":   {Data: []byte("package shallow")},
+				"x/foo/bar.go": {Data: []byte("package deep")},
+			},
+			extensions:    []string{".go"},
+			ignoreFiles:   []string{".gitignore"},
+			commentSymbol: "//",
+			roots:         []string{"."},
+			wantContains:  []string{"package deep"},
+			wantExcludes:  []string{"package shallow"},
+		},
+		{
+			name: "uses the configured comment symbol",
+			fsys: fstest.MapFS{
+				"a.go": {Data: []byte("package a")},
+			},
+			extensions:    []string{".go"},
+			commentSymbol: "#",
+			roots:         []string{"."},
+			wantContains:  []string{"# a.go"},
+			wantExcludes:  []string{"// a.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			formatter, err := NewFormatter("plain", tt.commentSymbol)
+			if err != nil {
+				t.Fatalf("NewFormatter: %v", err)
+			}
+
+			m := New(tt.extensions, tt.ignoreFiles, tt.commentSymbol, formatter, &buf)
+			if err := m.Merge(context.Background(), tt.fsys, tt.roots...); err != nil {
+				t.Fatalf("Merge: %v", err)
+			}
+
+			got := buf.String()
+			for _, want := range tt.wantContains {
+				if !strings.Contains(got, want) {
+					t.Errorf("output missing %q, got:\n%s", want, got)
+				}
+			}
+			for _, excl := range tt.wantExcludes {
+				if strings.Contains(got, excl) {
+					t.Errorf("output should not contain %q, got:\n%s", excl, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package merger
+
+// TokenCounter estimates how many language-model tokens a chunk of file content would
+// consume. Implementations don't need to be exact - they only need to be consistent
+// enough to keep chunks under a -max-tokens budget.
+type TokenCounter interface {
+	Count(content []byte) int
+}
+
+// ByteHeuristicCounter approximates token count as one token per four bytes, the rule
+// of thumb commonly used to estimate tokens for English text. It has no external
+// dependencies, which is why it's the default counter.
+type ByteHeuristicCounter struct{}
+
+func (ByteHeuristicCounter) Count(content []byte) int {
+	return (len(content) + 3) / 4
+}
@@ -0,0 +1,37 @@
+//go:build tiktoken
+
+package merger
+
+import (
+	"sync"
+
+	tiktoken "github.com/pkoukk/tiktoken-go"
+)
+
+// TiktokenCounter counts tokens with a real BPE tokenizer compatible with OpenAI's
+// tiktoken, for callers that need exact context-window accounting instead of
+// ByteHeuristicCounter's estimate. It's only compiled in under the "tiktoken" build
+// tag so the default binary stays dependency-free.
+type TiktokenCounter struct {
+	Encoding string
+
+	once sync.Once
+	enc  *tiktoken.Tiktoken
+	err  error
+}
+
+// NewTiktokenCounter builds a counter using the named tiktoken encoding, e.g.
+// "cl100k_base".
+func NewTiktokenCounter(encoding string) *TiktokenCounter {
+	return &TiktokenCounter{Encoding: encoding}
+}
+
+func (c *TiktokenCounter) Count(content []byte) int {
+	c.once.Do(func() {
+		c.enc, c.err = tiktoken.GetEncoding(c.Encoding)
+	})
+	if c.err != nil || c.enc == nil {
+		return ByteHeuristicCounter{}.Count(content)
+	}
+	return len(c.enc.Encode(string(content), nil, nil))
+}